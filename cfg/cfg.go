@@ -0,0 +1,84 @@
+// Package cfg defines the subset of the relay's top-level configuration
+// consumed by the input package and its pickle listener. The full config carries many
+// more fields (routes, destinations, aggregators, ...) owned by the rest of
+// the relay; this file only grows the stanzas that the inputs in this tree
+// actually read.
+package cfg
+
+import (
+	"github.com/graphite-ng/carbon-relay-ng/tracing"
+	m20 "github.com/metrics20/go-metrics20/carbon20"
+)
+
+// Config holds the metrics 2.0 validation settings, the pickle listener's
+// tuning knobs, and the optional inputs layered on top of it.
+type Config struct {
+	Validation_level_legacy struct{ Level m20.ValidationLevelLegacy }
+	Validation_level_m20    struct{ Level m20.ValidationLevelM20 }
+	Validate_order          bool
+
+	Pickle_max_message_bytes    int
+	Pickle_decode_workers       int
+	Pickle_accept_render_format bool
+
+	Kafka   KafkaConfig
+	MQTT    MQTTConfig
+	GRPC    GRPCConfig
+	Tracing tracing.Config
+}
+
+// KafkaConfig is the [kafka] config file stanza, translated into
+// input.KafkaConfig by input.InitFromConfig.
+type KafkaConfig struct {
+	Enabled        bool
+	Brokers        []string
+	Topics         []string
+	ConsumerGroup  string
+	InitialOffset  string // "oldest" or "newest"
+	Codec          string
+	InFlightWindow int
+
+	TLSEnabled    bool
+	TLSSkipVerify bool
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCAFile     string
+
+	SASLEnabled   bool
+	SASLMechanism string // "PLAIN" or "SCRAM-SHA-256" / "SCRAM-SHA-512"
+	SASLUsername  string
+	SASLPassword  string
+}
+
+// MQTTConfig is the [mqtt] config file stanza, translated into
+// input.MQTTConfig by input.InitFromConfig.
+type MQTTConfig struct {
+	Enabled   bool
+	BrokerURI string
+	ClientID  string
+	Username  string
+	Password  string
+
+	TLSEnabled    bool
+	TLSSkipVerify bool
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCAFile     string
+
+	QoS    byte
+	Topics []string
+	Format string
+}
+
+// GRPCConfig is the [grpc] config file stanza, translated into
+// input.GRPCConfig by input.InitFromConfig.
+type GRPCConfig struct {
+	Enabled bool
+	Addr    string
+
+	TLSEnabled  bool
+	TLSCertFile string
+	TLSKeyFile  string
+	MTLSEnabled bool
+	MTLSCAFile  string
+}
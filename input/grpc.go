@@ -0,0 +1,192 @@
+package input
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+
+	"github.com/graphite-ng/carbon-relay-ng/badmetrics"
+	"github.com/graphite-ng/carbon-relay-ng/cfg"
+	apiv1 "github.com/graphite-ng/carbon-relay-ng/pkg/api/v1"
+	"github.com/graphite-ng/carbon-relay-ng/table"
+	"github.com/graphite-ng/carbon-relay-ng/validate"
+	m20 "github.com/metrics20/go-metrics20/carbon20"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPCConfig holds everything needed to mount the MetricsIngest gRPC service.
+type GRPCConfig struct {
+	Addr string
+
+	TLSEnabled  bool
+	TLSCertFile string
+	TLSKeyFile  string
+	MTLSEnabled bool
+	MTLSCAFile  string
+}
+
+// GRPC mounts the MetricsIngest service and converts every received metric
+// into the same "metric value timestamp" byte form dispatched by
+// Pickle.Handle, tags encoded in metrics 2.0 format so m20.ValidatePacket
+// accepts them.
+type GRPC struct {
+	apiv1.UnimplementedMetricsIngestServer
+
+	config cfg.Config
+	bad    *badmetrics.BadMetrics
+	table  *table.Table
+
+	server *grpc.Server
+}
+
+// NewGRPC starts listening on grpcCfg.Addr and serving the MetricsIngest
+// service in the background.
+func NewGRPC(config cfg.Config, grpcCfg GRPCConfig, tbl *table.Table, bad *badmetrics.BadMetrics) (*GRPC, error) {
+	g := &GRPC{
+		config: config,
+		bad:    bad,
+		table:  tbl,
+	}
+
+	var opts []grpc.ServerOption
+	if grpcCfg.TLSEnabled {
+		creds, err := grpcServerCreds(grpcCfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	l, err := net.Listen("tcp", grpcCfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("grpc.go: couldn't listen on %s: %s", grpcCfg.Addr, err)
+	}
+
+	g.server = grpc.NewServer(opts...)
+	apiv1.RegisterMetricsIngestServer(g.server, g)
+
+	go func() {
+		log.Debug(fmt.Sprintf("grpc.go: serving MetricsIngest on %s", grpcCfg.Addr))
+		if err := g.server.Serve(l); err != nil {
+			log.Error("grpc.go: server stopped serving: " + err.Error())
+		}
+	}()
+
+	return g, nil
+}
+
+func grpcServerCreds(grpcCfg GRPCConfig) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(grpcCfg.TLSCertFile, grpcCfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("grpc.go: couldn't load TLS keypair: %s", err)
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if grpcCfg.MTLSEnabled {
+		caBytes, err := ioutil.ReadFile(grpcCfg.MTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc.go: couldn't read mTLS CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("grpc.go: couldn't parse mTLS CA file %s", grpcCfg.MTLSCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Push implements apiv1.MetricsIngestServer. It reads MetricBatch messages
+// off the stream until the client closes it, then acks the whole call with
+// counts of accepted/invalid/out-of-order metrics across every batch sent.
+func (g *GRPC) Push(stream apiv1.MetricsIngest_PushServer) error {
+	ack := &apiv1.PushAck{}
+
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(ack)
+		}
+		if err != nil {
+			log.Error("grpc.go: error reading MetricBatch: " + err.Error())
+			return err
+		}
+
+		for _, metric := range batch.Metrics {
+			numIn.Inc(1)
+			itemSpan := opentracing.StartSpan("grpc.validate_and_dispatch_item")
+
+			buf, err := encodeMetric(metric)
+			if err != nil {
+				log.Error("grpc.go: couldn't encode metric: " + err.Error())
+				numInvalid.Inc(1)
+				ack.Invalid++
+				itemSpan.Finish()
+				continue
+			}
+			itemSpan.SetTag("metric", metric.Name)
+
+			key, val, ts, err := m20.ValidatePacket(buf, g.config.Validation_level_legacy.Level, g.config.Validation_level_m20.Level)
+			if err != nil {
+				log.Debug("grpc.go: metric failed to pass m20 Packet validation!")
+				g.bad.Add(key, buf, err)
+				numInvalid.Inc(1)
+				ack.Invalid++
+				itemSpan.Finish()
+				continue
+			}
+
+			if g.config.Validate_order {
+				if err := validate.Ordered(key, ts); err != nil {
+					log.Debug("grpc.go: order validation failed!")
+					g.bad.Add(key, buf, err)
+					numOutOfOrder.Inc(1)
+					ack.OutOfOrder++
+					itemSpan.Finish()
+					continue
+				}
+			}
+
+			ctx := opentracing.ContextWithSpan(context.Background(), itemSpan)
+			g.table.Dispatch(ctx, buf, val, ts)
+			ack.Accepted++
+			itemSpan.Finish()
+		}
+	}
+}
+
+// encodeMetric renders a protobuf Metric into the metrics 2.0 line format
+// ("name;tag=value;tag=value value timestamp") so m20.ValidatePacket accepts it.
+func encodeMetric(metric *apiv1.Metric) ([]byte, error) {
+	if metric.Name == "" {
+		return nil, fmt.Errorf("metric name must not be empty")
+	}
+
+	keys := make([]string, 0, len(metric.Tags))
+	for k := range metric.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	name := metric.Name
+	for _, k := range keys {
+		name += fmt.Sprintf(";%s=%s", k, metric.Tags[k])
+	}
+
+	return []byte(fmt.Sprintf("%s %f %d", name, metric.Value, metric.Timestamp)), nil
+}
+
+// Stop gracefully stops the gRPC server.
+func (g *GRPC) Stop() {
+	g.server.GracefulStop()
+}
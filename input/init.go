@@ -0,0 +1,92 @@
+package input
+
+import (
+	"io"
+
+	"github.com/graphite-ng/carbon-relay-ng/badmetrics"
+	"github.com/graphite-ng/carbon-relay-ng/cfg"
+	"github.com/graphite-ng/carbon-relay-ng/table"
+	"github.com/graphite-ng/carbon-relay-ng/tracing"
+)
+
+// InitFromConfig sets the global OpenTracing tracer and starts whichever
+// optional inputs are enabled in config, on top of the always-on
+// plaintext/pickle TCP listener started separately by NewPickle. It is the
+// single place that turns config stanzas into running inputs, so enabling
+// an input is a config change rather than a code change. The returned
+// io.Closer flushes the tracing exporter on shutdown and must be closed
+// even when tracing is disabled (it's a no-op close in that case).
+func InitFromConfig(config cfg.Config, tbl *table.Table, bad *badmetrics.BadMetrics) (io.Closer, error) {
+	tracingCloser, err := tracing.Init(config.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Kafka.Enabled {
+		if _, err := NewKafka(config, kafkaConfigFrom(config.Kafka), tbl, bad); err != nil {
+			return tracingCloser, err
+		}
+	}
+
+	if config.MQTT.Enabled {
+		if _, err := NewMQTT(config, mqttConfigFrom(config.MQTT), tbl, bad); err != nil {
+			return tracingCloser, err
+		}
+	}
+
+	if config.GRPC.Enabled {
+		if _, err := NewGRPC(config, grpcConfigFrom(config.GRPC), tbl, bad); err != nil {
+			return tracingCloser, err
+		}
+	}
+
+	return tracingCloser, nil
+}
+
+func kafkaConfigFrom(c cfg.KafkaConfig) KafkaConfig {
+	return KafkaConfig{
+		Brokers:        c.Brokers,
+		Topics:         c.Topics,
+		ConsumerGroup:  c.ConsumerGroup,
+		InitialOffset:  c.InitialOffset,
+		Codec:          KafkaCodec(c.Codec),
+		InFlightWindow: c.InFlightWindow,
+		TLSEnabled:     c.TLSEnabled,
+		TLSSkipVerify:  c.TLSSkipVerify,
+		TLSCertFile:    c.TLSCertFile,
+		TLSKeyFile:     c.TLSKeyFile,
+		TLSCAFile:      c.TLSCAFile,
+		SASLEnabled:    c.SASLEnabled,
+		SASLMechanism:  c.SASLMechanism,
+		SASLUsername:   c.SASLUsername,
+		SASLPassword:   c.SASLPassword,
+	}
+}
+
+func mqttConfigFrom(c cfg.MQTTConfig) MQTTConfig {
+	return MQTTConfig{
+		BrokerURI:     c.BrokerURI,
+		ClientID:      c.ClientID,
+		Username:      c.Username,
+		Password:      c.Password,
+		TLSEnabled:    c.TLSEnabled,
+		TLSSkipVerify: c.TLSSkipVerify,
+		TLSCertFile:   c.TLSCertFile,
+		TLSKeyFile:    c.TLSKeyFile,
+		TLSCAFile:     c.TLSCAFile,
+		QoS:           c.QoS,
+		Topics:        c.Topics,
+		Format:        MQTTFormat(c.Format),
+	}
+}
+
+func grpcConfigFrom(c cfg.GRPCConfig) GRPCConfig {
+	return GRPCConfig{
+		Addr:        c.Addr,
+		TLSEnabled:  c.TLSEnabled,
+		TLSCertFile: c.TLSCertFile,
+		TLSKeyFile:  c.TLSKeyFile,
+		MTLSEnabled: c.MTLSEnabled,
+		MTLSCAFile:  c.MTLSCAFile,
+	}
+}
@@ -0,0 +1,223 @@
+package input
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/graphite-ng/carbon-relay-ng/badmetrics"
+	"github.com/graphite-ng/carbon-relay-ng/cfg"
+	"github.com/graphite-ng/carbon-relay-ng/table"
+	"github.com/graphite-ng/carbon-relay-ng/validate"
+	ogorek "github.com/kisielk/og-rek"
+	m20 "github.com/metrics20/go-metrics20/carbon20"
+	"github.com/opentracing/opentracing-go"
+)
+
+// MQTTFormat selects how an MQTT message payload should be decoded into
+// one or more "metric value timestamp" packets.
+type MQTTFormat string
+
+const (
+	MQTTFormatPlaintext MQTTFormat = "plaintext"
+	MQTTFormatPickle    MQTTFormat = "pickle"
+	MQTTFormatJSON      MQTTFormat = "json"
+)
+
+// MQTTConfig holds everything needed to set up an MQTT subscription input.
+type MQTTConfig struct {
+	BrokerURI string
+	ClientID  string
+	Username  string
+	Password  string
+
+	TLSEnabled    bool
+	TLSSkipVerify bool
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCAFile     string
+
+	QoS    byte
+	Topics []string
+	Format MQTTFormat
+}
+
+// mqttJSONMetric is the shape accepted for MQTTFormatJSON payloads.
+type mqttJSONMetric struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// MQTT subscribes to one or more MQTT topic filters and feeds every message
+// through the same validation and dispatch pipeline used by Pickle.Handle.
+type MQTT struct {
+	config cfg.Config
+	mqtt   MQTTConfig
+	bad    *badmetrics.BadMetrics
+	table  *table.Table
+
+	client mqtt.Client
+}
+
+// NewMQTT connects to the configured broker and subscribes to the configured
+// topic filters in the background.
+func NewMQTT(config cfg.Config, mqttCfg MQTTConfig, tbl *table.Table, bad *badmetrics.BadMetrics) (*MQTT, error) {
+	m := &MQTT{
+		config: config,
+		mqtt:   mqttCfg,
+		bad:    bad,
+		table:  tbl,
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(mqttCfg.BrokerURI)
+	opts.SetClientID(mqttCfg.ClientID)
+	if mqttCfg.Username != "" {
+		opts.SetUsername(mqttCfg.Username)
+		opts.SetPassword(mqttCfg.Password)
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(m.onConnect)
+
+	if mqttCfg.TLSEnabled {
+		tlsConfig := &tls.Config{InsecureSkipVerify: mqttCfg.TLSSkipVerify}
+		if mqttCfg.TLSCertFile != "" && mqttCfg.TLSKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(mqttCfg.TLSCertFile, mqttCfg.TLSKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("mqtt.go: couldn't load TLS keypair: %s", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if mqttCfg.TLSCAFile != "" {
+			caBytes, err := ioutil.ReadFile(mqttCfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("mqtt.go: couldn't read TLS CA file: %s", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caBytes) {
+				return nil, fmt.Errorf("mqtt.go: couldn't parse TLS CA file %s", mqttCfg.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	m.client = mqtt.NewClient(opts)
+	token := m.client.Connect()
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("mqtt.go: couldn't connect to broker: %s", err)
+	}
+
+	return m, nil
+}
+
+func (m *MQTT) onConnect(c mqtt.Client) {
+	for _, topic := range m.mqtt.Topics {
+		log.Debug(fmt.Sprintf("mqtt.go: subscribing to topic %s", topic))
+		token := c.Subscribe(topic, m.mqtt.QoS, m.onMessage)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			log.Error(fmt.Sprintf("mqtt.go: couldn't subscribe to topic %s: %s", topic, err))
+		}
+	}
+}
+
+func (m *MQTT) onMessage(c mqtt.Client, msg mqtt.Message) {
+	switch m.mqtt.Format {
+	case MQTTFormatPickle:
+		m.handlePickle(msg.Payload())
+	case MQTTFormatJSON:
+		m.handleJSON(msg.Payload())
+	default:
+		m.handlePlaintext(msg.Payload())
+	}
+}
+
+func (m *MQTT) handlePlaintext(buf []byte) {
+	numIn.Inc(1)
+	itemSpan := opentracing.StartSpan("mqtt.validate_and_dispatch_item")
+	defer itemSpan.Finish()
+	m.dispatch(buf, itemSpan)
+}
+
+func (m *MQTT) handlePickle(payload []byte) {
+	decoder := ogorek.NewDecoder(bytes.NewReader(payload))
+	rawDecoded, err := decoder.Decode()
+	if err != nil {
+		log.Error("mqtt.go: error reading pickled message: " + err.Error())
+		return
+	}
+	decoded, ok := rawDecoded.([]interface{})
+	if !ok {
+		log.Error(fmt.Sprintf("mqtt.go: unrecognized type %T for pickled message", rawDecoded))
+		return
+	}
+	for _, rawItem := range decoded {
+		itemSpan := opentracing.StartSpan("mqtt.validate_and_dispatch_item")
+		m.handlePickleItem(rawItem, itemSpan)
+		itemSpan.Finish()
+	}
+}
+
+// handlePickleItem reuses the same decodePickleItem shape validation as
+// Pickle.Handle, instead of re-deriving a weaker ad hoc parse: decodePickleItem
+// rejects unrecognized value/timestamp types and renders numbers the way
+// m20.ValidatePacket expects, where "%v" on a float64 could emit scientific
+// notation that fails validation.
+func (m *MQTT) handlePickleItem(rawItem interface{}, itemSpan opentracing.Span) {
+	numIn.Inc(1)
+	buf, ok := decodePickleItem(rawItem, itemSpan)
+	if !ok {
+		return
+	}
+	m.dispatch(buf, itemSpan)
+}
+
+func (m *MQTT) handleJSON(payload []byte) {
+	var metrics []mqttJSONMetric
+	if err := json.Unmarshal(payload, &metrics); err != nil {
+		var single mqttJSONMetric
+		if err := json.Unmarshal(payload, &single); err != nil {
+			log.Error("mqtt.go: error reading json message: " + err.Error())
+			return
+		}
+		metrics = []mqttJSONMetric{single}
+	}
+	for _, metric := range metrics {
+		numIn.Inc(1)
+		itemSpan := opentracing.StartSpan("mqtt.validate_and_dispatch_item")
+		buf := []byte(fmt.Sprintf("%s %f %d", metric.Name, metric.Value, metric.Timestamp))
+		m.dispatch(buf, itemSpan)
+		itemSpan.Finish()
+	}
+}
+
+func (m *MQTT) dispatch(buf []byte, itemSpan opentracing.Span) {
+	key, val, ts, err := m20.ValidatePacket(buf, m.config.Validation_level_legacy.Level, m.config.Validation_level_m20.Level)
+	if err != nil {
+		m.bad.Add(key, buf, err)
+		numInvalid.Inc(1)
+		return
+	}
+	if m.config.Validate_order {
+		if err := validate.Ordered(key, ts); err != nil {
+			m.bad.Add(key, buf, err)
+			numOutOfOrder.Inc(1)
+			return
+		}
+	}
+	ctx := opentracing.ContextWithSpan(context.Background(), itemSpan)
+	m.table.Dispatch(ctx, buf, val, ts)
+}
+
+// Stop disconnects from the broker.
+func (m *MQTT) Stop() {
+	m.client.Disconnect(250)
+}
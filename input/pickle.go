@@ -3,11 +3,16 @@ package input
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"net"
+	"strconv"
+	"sync"
 
 	"github.com/graphite-ng/carbon-relay-ng/badmetrics"
 	"github.com/graphite-ng/carbon-relay-ng/cfg"
@@ -15,8 +20,19 @@ import (
 	"github.com/graphite-ng/carbon-relay-ng/validate"
 	ogorek "github.com/kisielk/og-rek"
 	m20 "github.com/metrics20/go-metrics20/carbon20"
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
 )
 
+// defaultPickleMaxMessageBytes preserves the historical 500MB cap on a
+// single pickle payload, now enforced via io.LimitReader instead of an
+// up-front allocation.
+const defaultPickleMaxMessageBytes = 500 * 1024 * 1024
+
+// defaultPickleDecodeWorkers is how many goroutines validate and dispatch
+// decoded items concurrently when pickle_decode_workers isn't configured.
+const defaultPickleDecodeWorkers = 4
+
 type Pickle struct {
 	config cfg.Config
 	bad    *badmetrics.BadMetrics
@@ -31,21 +47,104 @@ func NewPickle(config cfg.Config, addr string, tbl *table.Table, bad *badmetrics
 	return l, nil
 }
 
+// pickleItem is a shape-validated metric pulled out of a decoded pickle
+// payload, travelling from the decode goroutine to a dispatch worker over a
+// bounded channel. This lets m20 validation and table.Dispatch proceed
+// concurrently with further network reads, instead of the decode loop
+// blocking on them item by item.
+//
+// payloadDone is marked once this item has actually been validated and
+// dispatched, so the payload's span can be finished when every item it
+// produced is done, not as soon as they're enqueued.
+type pickleItem struct {
+	buf         []byte
+	span        opentracing.Span
+	payloadDone *sync.WaitGroup
+}
+
+func (p *Pickle) maxMessageBytes() int {
+	if p.config.Pickle_max_message_bytes > 0 {
+		return p.config.Pickle_max_message_bytes
+	}
+	return defaultPickleMaxMessageBytes
+}
+
+func (p *Pickle) decodeWorkers() int {
+	if p.config.Pickle_decode_workers > 0 {
+		return p.config.Pickle_decode_workers
+	}
+	return defaultPickleDecodeWorkers
+}
+
+// Handle reads pickled payloads off c until the connection is closed. Each
+// payload gets its own OpenTracing span ("pickle.handle_payload"), and each
+// item within it gets a child span ("pickle.validate_and_dispatch_item").
+// table.Dispatch and route.Route carry that span context all the way to the
+// actual send, so an operator can see exactly where a given metric stalled
+// end to end.
+//
+// Decoding and dispatching run in separate goroutines joined by bounded,
+// per-worker channels: the decode loop hands the connection's bufio.Reader
+// (wrapped in an io.LimitReader per payload) straight to ogorek.NewDecoder
+// rather than buffering the whole payload first, so peak allocation is
+// O(chunk) instead of O(payload). Items are sharded across workers by a hash
+// of their metric key rather than round-robined, so that all the points for
+// a given metric always land on the same worker and are dispatched in the
+// order they were decoded; only different metrics' items may interleave.
 func (p *Pickle) Handle(c net.Conn) {
 	defer c.Close()
 	// TODO c.SetTimeout(60e9)
 	r := bufio.NewReaderSize(c, 4096)
-	// 500MB max payload size per pickle body
-	maxLength := 500 * 1024 * 1024
-	log.Debug("pickle.go: entering ReadLoop...")
-ReadLoop:
-	for {
 
-		// Note that everything in this loop should proceed as fast as it can
-		// so we're not blocked and can keep processing
-		// so the validation, the pipeline initiated via table.Dispatch(), etc
-		// must never block.
+	workers := p.decodeWorkers()
+	queues := make([]chan pickleItem, workers)
+	for i := range queues {
+		queues[i] = make(chan pickleItem, 64)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(items <-chan pickleItem) {
+			defer wg.Done()
+			for it := range items {
+				p.validateAndDispatch(it.buf, it.span)
+				if it.payloadDone != nil {
+					it.payloadDone.Done()
+				}
+			}
+		}(queues[i])
+	}
+
+	p.decodeLoop(r, queues)
 
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+}
+
+// keyedWorker picks which of the workers queues an item belongs on, hashing
+// the metric key (the bytes of buf up to the first space) so that every
+// point for the same metric is always handled by the same worker.
+func keyedWorker(buf []byte, workers int) int {
+	key := buf
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		key = buf[:i]
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// decodeLoop reads length-prefixed pickle payloads off r and pushes each
+// shape-validated item onto the queue its metric key hashes to, until the
+// connection is closed or a framing error is hit.
+func (p *Pickle) decodeLoop(r *bufio.Reader, queues []chan pickleItem) {
+	maxLength := p.maxMessageBytes()
+
+	log.Debug("pickle.go: entering ReadLoop...")
+	for {
 		log.Debug("pickle.go: detecting payload length with binary.Read...")
 		var length uint32
 		err := binary.Read(r, binary.BigEndian, &length)
@@ -77,147 +176,254 @@ ReadLoop:
 			break
 		}
 
-		log.Debug("pickle.go: reading payload...")
-		lengthRead := 0
-		chunkLength := 4096
-		if chunkLength > lengthTotal {
-			chunkLength = lengthTotal
-		}
-		chunk := make([]byte, chunkLength, chunkLength)
-		var payload bytes.Buffer
-		for {
-			toRead := lengthTotal - lengthRead
-			if toRead > chunkLength {
-				toRead = chunkLength
-			}
-			tmpLengthRead, err := r.Read(chunk[:toRead])
-			if err != nil {
-				log.Error("pickle.go: couldn't read payload: " + err.Error())
-				break ReadLoop
-			}
-			lengthRead += tmpLengthRead
-			payload.Write(chunk[:tmpLengthRead])
-			if lengthRead == lengthTotal {
-				log.Debug("pickle.go: done reading payload")
-				break
-			}
-		}
+		span := opentracing.StartSpan("pickle.handle_payload")
+		span.SetTag("payload.length", lengthTotal)
 
-		decoder := ogorek.NewDecoder(&payload)
-
-		log.Debug("pickle.go: decoding pickled data...")
+		log.Debug("pickle.go: decoding pickled data straight off the connection...")
+		payload := io.LimitReader(r, int64(lengthTotal))
+		decoder := ogorek.NewDecoder(payload)
 		rawDecoded, err := decoder.Decode()
 		if err != nil {
 			if io.ErrUnexpectedEOF != err {
 				log.Error("pickle.go: error reading pickled data " + err.Error())
 			}
 			log.Debug("pickle.go: detected ErrUnexpectedEOF while decoding pickled data, nothing more to decode, breaking")
+			span.Finish()
 			break
 		}
 		log.Debug("pickle.go: done decoding pickled data")
 
+		// The decoder may stop short of lengthTotal (e.g. trailing padding
+		// after the STOP opcode); drain the rest so the next length prefix
+		// lines back up with the stream.
+		io.Copy(ioutil.Discard, payload)
+
 		log.Debug("pickle.go: checking the type of pickled data...")
 		decoded, ok := rawDecoded.([]interface{})
 		if !ok {
 			log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for pickled data", rawDecoded))
+			span.Finish()
 			break
 		}
 		log.Debug("pickle.go: done checking the type of pickled data")
+		span.SetTag("items.count", len(decoded))
 
 		log.Debug("pickle.go: entering ItemLoop...")
-
-	ItemLoop:
+		var payloadDone sync.WaitGroup
 		for _, rawItem := range decoded {
-			numIn.Inc(1)
-
-			log.Debug("pickle.go: doing high-level validation of unpickled item and data...")
-			item, ok := rawItem.(ogorek.Tuple)
-			if !ok {
-				log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for item", rawItem))
-				numInvalid.Inc(1)
-				continue
-			}
-			if len(item) != 2 {
-				log.Error(fmt.Sprintf("pickle.go: item length must be 2, got %d", len(item)))
-				numInvalid.Inc(1)
-				continue
+			for _, it := range p.expandPickleItem(rawItem, span) {
+				it.payloadDone = &payloadDone
+				payloadDone.Add(1)
+				queues[keyedWorker(it.buf, len(queues))] <- it
 			}
+		}
+		log.Debug("pickle.go: exiting ItemLoop")
 
-			metric, ok := item[0].(string)
-			if !ok {
-				log.Error(fmt.Sprintf("pickle.go: item metric must be a string, got %T", item[0]))
-				numInvalid.Inc(1)
-				continue
-			}
+		// The payload's span must outlive every item span it parents, so
+		// finish it only once every item has actually been dispatched, not
+		// as soon as it's been handed to a worker. Waiting happens off the
+		// decode loop so a slow dispatch never stalls the next read.
+		go func() {
+			payloadDone.Wait()
+			span.Finish()
+		}()
+		log.Debug("pickle.go: exiting ReadLoop")
+	}
+}
 
-			data, ok := item[1].(ogorek.Tuple)
-			if !ok {
-				log.Error(fmt.Sprintf("pickle.go: item data must be an array, got %T", item[1]))
-				numInvalid.Inc(1)
-				continue
-			}
-			if len(data) != 2 {
-				log.Error(fmt.Sprintf("pickle.go: item data length must be 2, got %d", len(data)))
-				numInvalid.Inc(1)
-				continue
-			}
-			log.Debug("pickle.go: done doing high-level validation of unpickled item and data")
-
-			var value string
-			switch data[1].(type) {
-			case string:
-				value = data[1].(string)
-			case uint8, uint16, uint32, uint64, int8, int16, int32, int64:
-				value = fmt.Sprintf("%d", data[1])
-			case float32, float64:
-				value = fmt.Sprintf("%f", data[1])
-			default:
-				log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for value", data[1]))
-				numInvalid.Inc(1)
-				continue ItemLoop
-			}
+// expandPickleItem turns one element of a decoded pickle payload into zero
+// or more dispatch-ready pickleItems. The ordinary shape is an
+// ogorek.Tuple{name, Tuple{ts, val}} metric, handled by decodePickleItem.
+// When pickle_accept_render_format is enabled, a map[interface{}]interface{}
+// with "metric_path"/"values"/"start"/"step" keys is recognized as a
+// graphite-web/carbonapi find/render response and expanded into one
+// pickleItem per (name, value, ts=start+i*step) point, skipping nil values.
+func (p *Pickle) expandPickleItem(rawItem interface{}, parentSpan opentracing.Span) []pickleItem {
+	if p.config.Pickle_accept_render_format {
+		if renderMap, ok := rawItem.(map[interface{}]interface{}); ok {
+			return expandRenderMap(renderMap, parentSpan)
+		}
+	}
 
-			var timestamp string
-			switch data[0].(type) {
-			case string:
-				timestamp = data[0].(string)
-			case uint8, uint16, uint32, uint64, int8, int16, int32, int64, (*big.Int):
-				timestamp = fmt.Sprintf("%d", data[0])
-			case float32, float64:
-				timestamp = fmt.Sprintf("%.0f", data[0])
-			default:
-				log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for timestamp", data[0]))
-				numInvalid.Inc(1)
-				continue ItemLoop
-			}
+	numIn.Inc(1)
+	itemSpan := opentracing.StartSpan("pickle.validate_and_dispatch_item", opentracing.ChildOf(parentSpan.Context()))
+	buf, ok := decodePickleItem(rawItem, itemSpan)
+	if !ok {
+		itemSpan.Finish()
+		return nil
+	}
+	return []pickleItem{{buf: buf, span: itemSpan}}
+}
 
-			buf := []byte(metric + " " + value + " " + timestamp)
+// expandRenderMap expands a single graphite-web render response into its
+// per-point metrics.
+func expandRenderMap(renderMap map[interface{}]interface{}, parentSpan opentracing.Span) []pickleItem {
+	name, ok := renderMap["metric_path"].(string)
+	if !ok || name == "" {
+		log.Error(fmt.Sprintf("pickle.go: render map has missing/invalid \"metric_path\", got %T", renderMap["metric_path"]))
+		numInvalid.Inc(1)
+		return nil
+	}
 
-			log.Debug("pickle.go: passing unpickled metric to m20 Packet validator...")
-			key, val, ts, err := m20.ValidatePacket(buf, p.config.Validation_level_legacy.Level, p.config.Validation_level_m20.Level)
-			if err != nil {
-				log.Debug("pickle.go: metric failed to pass m20 Packet validation!")
-				p.bad.Add(key, buf, err)
-				numInvalid.Inc(1)
-				continue
-			}
+	values, ok := renderMap["values"].([]interface{})
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: render map for metric %q has missing/invalid \"values\"", name))
+		numInvalid.Inc(1)
+		return nil
+	}
 
-			if p.config.Validate_order {
-				log.Debug("pickle.go: order validation enabled, performing order validation...")
-				err = validate.Ordered(key, ts)
-				if err != nil {
-					log.Debug("pickle.go: order validation failed!")
-					p.bad.Add(key, buf, err)
-					numOutOfOrder.Inc(1)
-					continue
-				}
-			}
+	start, startOk := pickleTimestampString(renderMap["start"])
+	step, stepOk := pickleTimestampString(renderMap["step"])
+	startTs, startErr := strconv.ParseInt(start, 10, 64)
+	stepTs, stepErr := strconv.ParseInt(step, 10, 64)
+	if !startOk || !stepOk || startErr != nil || stepErr != nil {
+		log.Error(fmt.Sprintf("pickle.go: render map for metric %q has missing/invalid \"start\" or \"step\"", name))
+		numInvalid.Inc(1)
+		return nil
+	}
+
+	out := make([]pickleItem, 0, len(values))
+	for i, rawValue := range values {
+		if rawValue == nil {
+			continue
+		}
 
-			log.Debug("pickle.go: all good, dispatching metrics buffer")
-			p.table.Dispatch(buf, val, ts)
+		numIn.Inc(1)
+		itemSpan := opentracing.StartSpan("pickle.validate_and_dispatch_item", opentracing.ChildOf(parentSpan.Context()))
+		itemSpan.SetTag("metric", name)
 
-			log.Debug("pickle.go: exiting ItemLoop")
+		value, ok := pickleValueString(rawValue)
+		if !ok {
+			log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for render value", rawValue))
+			numInvalid.Inc(1)
+			itemSpan.LogFields(otlog.String("error", "unrecognized render value type"))
+			itemSpan.Finish()
+			continue
 		}
-		log.Debug("pickle.go: exiting ReadLoop")
+
+		ts := startTs + int64(i)*stepTs
+		buf := []byte(fmt.Sprintf("%s %s %d", name, value, ts))
+		out = append(out, pickleItem{buf: buf, span: itemSpan})
+	}
+	return out
+}
+
+// decodePickleItem turns a raw decoded pickle element into the "metric value
+// timestamp" byte form m20.ValidatePacket expects, doing the high-level
+// shape validation that used to live inline in Pickle.Handle's ItemLoop.
+func decodePickleItem(rawItem interface{}, itemSpan opentracing.Span) ([]byte, bool) {
+	log.Debug("pickle.go: doing high-level validation of unpickled item and data...")
+	item, ok := rawItem.(ogorek.Tuple)
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for item", rawItem))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "unrecognized item type"))
+		return nil, false
+	}
+	if len(item) != 2 {
+		log.Error(fmt.Sprintf("pickle.go: item length must be 2, got %d", len(item)))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "wrong item length"))
+		return nil, false
+	}
+
+	metric, ok := item[0].(string)
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: item metric must be a string, got %T", item[0]))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "metric not a string"))
+		return nil, false
+	}
+
+	data, ok := item[1].(ogorek.Tuple)
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: item data must be an array, got %T", item[1]))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "data not an array"))
+		return nil, false
 	}
+	if len(data) != 2 {
+		log.Error(fmt.Sprintf("pickle.go: item data length must be 2, got %d", len(data)))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "wrong data length"))
+		return nil, false
+	}
+	log.Debug("pickle.go: done doing high-level validation of unpickled item and data")
+	itemSpan.SetTag("metric", metric)
+
+	value, ok := pickleValueString(data[1])
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for value", data[1]))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "unrecognized value type"))
+		return nil, false
+	}
+
+	timestamp, ok := pickleTimestampString(data[0])
+	if !ok {
+		log.Error(fmt.Sprintf("pickle.go: Unrecognized type %T for timestamp", data[0]))
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "unrecognized timestamp type"))
+		return nil, false
+	}
+
+	return []byte(metric + " " + value + " " + timestamp), true
+}
+
+func pickleValueString(raw interface{}) (string, bool) {
+	switch raw.(type) {
+	case string:
+		return raw.(string), true
+	case uint8, uint16, uint32, uint64, int8, int16, int32, int64:
+		return fmt.Sprintf("%d", raw), true
+	case float32, float64:
+		return fmt.Sprintf("%f", raw), true
+	default:
+		return "", false
+	}
+}
+
+func pickleTimestampString(raw interface{}) (string, bool) {
+	switch raw.(type) {
+	case string:
+		return raw.(string), true
+	case uint8, uint16, uint32, uint64, int8, int16, int32, int64, (*big.Int):
+		return fmt.Sprintf("%d", raw), true
+	case float32, float64:
+		return fmt.Sprintf("%.0f", raw), true
+	default:
+		return "", false
+	}
+}
+
+// validateAndDispatch runs m20/order validation on buf and, if it passes,
+// hands it to table.Dispatch. itemSpan is always finished before returning.
+func (p *Pickle) validateAndDispatch(buf []byte, itemSpan opentracing.Span) {
+	defer itemSpan.Finish()
+
+	log.Debug("pickle.go: passing unpickled metric to m20 Packet validator...")
+	key, val, ts, err := m20.ValidatePacket(buf, p.config.Validation_level_legacy.Level, p.config.Validation_level_m20.Level)
+	if err != nil {
+		log.Debug("pickle.go: metric failed to pass m20 Packet validation!")
+		p.bad.Add(key, buf, err)
+		numInvalid.Inc(1)
+		itemSpan.LogFields(otlog.String("error", "m20 validation failed"))
+		return
+	}
+
+	if p.config.Validate_order {
+		log.Debug("pickle.go: order validation enabled, performing order validation...")
+		err = validate.Ordered(key, ts)
+		if err != nil {
+			log.Debug("pickle.go: order validation failed!")
+			p.bad.Add(key, buf, err)
+			numOutOfOrder.Inc(1)
+			itemSpan.LogFields(otlog.String("error", "out of order"))
+			return
+		}
+	}
+
+	log.Debug("pickle.go: all good, dispatching metrics buffer")
+	ctx := opentracing.ContextWithSpan(context.Background(), itemSpan)
+	p.table.Dispatch(ctx, buf, val, ts)
 }
@@ -0,0 +1,77 @@
+package input
+
+import (
+	"testing"
+
+	ogorek "github.com/kisielk/og-rek"
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestKeyedWorkerSameKeySameWorker(t *testing.T) {
+	const workers = 8
+	bufs := [][]byte{
+		[]byte("a.b.c 1 100"),
+		[]byte("a.b.c 2 200"),
+		[]byte("a.b.c 3 300"),
+	}
+
+	want := keyedWorker(bufs[0], workers)
+	for _, buf := range bufs[1:] {
+		if got := keyedWorker(buf, workers); got != want {
+			t.Errorf("keyedWorker(%q, %d) = %d, want %d (same metric key as %q)", buf, workers, got, want, bufs[0])
+		}
+	}
+}
+
+func TestKeyedWorkerInRange(t *testing.T) {
+	const workers = 4
+	for _, buf := range [][]byte{
+		[]byte("no.spaces.in.this.key"),
+		[]byte("a.b.c 1 100"),
+		[]byte(" 1 100"),
+	} {
+		if got := keyedWorker(buf, workers); got < 0 || got >= workers {
+			t.Errorf("keyedWorker(%q, %d) = %d, want in [0, %d)", buf, workers, got, workers)
+		}
+	}
+}
+
+func TestDecodePickleItemValid(t *testing.T) {
+	item := ogorek.Tuple{"a.b.c", ogorek.Tuple{int64(1234), 5.0}}
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	buf, ok := decodePickleItem(item, span)
+	if !ok {
+		t.Fatalf("decodePickleItem(%v) = _, false, want true", item)
+	}
+	if want := "a.b.c 5.000000 1234"; string(buf) != want {
+		t.Errorf("decodePickleItem(%v) = %q, want %q", item, buf, want)
+	}
+}
+
+func TestDecodePickleItemInvalidShape(t *testing.T) {
+	cases := []struct {
+		name string
+		item interface{}
+	}{
+		{"not a tuple", "a.b.c"},
+		{"wrong tuple length", ogorek.Tuple{"a.b.c"}},
+		{"metric not a string", ogorek.Tuple{42, ogorek.Tuple{int64(1234), 5.0}}},
+		{"data not a tuple", ogorek.Tuple{"a.b.c", "nope"}},
+		{"data wrong length", ogorek.Tuple{"a.b.c", ogorek.Tuple{int64(1234)}}},
+		{"unrecognized value type", ogorek.Tuple{"a.b.c", ogorek.Tuple{int64(1234), []int{1}}}},
+		{"unrecognized timestamp type", ogorek.Tuple{"a.b.c", ogorek.Tuple{[]int{1}, 5.0}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			span := opentracing.StartSpan("test")
+			defer span.Finish()
+
+			if _, ok := decodePickleItem(c.item, span); ok {
+				t.Errorf("decodePickleItem(%v) = _, true, want false", c.item)
+			}
+		})
+	}
+}
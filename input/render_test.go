@@ -0,0 +1,97 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestPickleValueString(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want string
+		ok   bool
+	}{
+		{"5.5", "5.5", true},
+		{int64(5), "5", true},
+		{uint32(5), "5", true},
+		{5.5, "5.500000", true},
+		{[]int{1}, "", false},
+		{nil, "", false},
+	}
+	for _, c := range cases {
+		got, ok := pickleValueString(c.in)
+		if ok != c.ok || got != c.want {
+			t.Errorf("pickleValueString(%v) = %q, %v, want %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestPickleTimestampString(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want string
+		ok   bool
+	}{
+		{"1234", "1234", true},
+		{int64(1234), "1234", true},
+		{1234.0, "1234", true},
+		{[]int{1}, "", false},
+	}
+	for _, c := range cases {
+		got, ok := pickleTimestampString(c.in)
+		if ok != c.ok || got != c.want {
+			t.Errorf("pickleTimestampString(%v) = %q, %v, want %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestExpandRenderMapValid(t *testing.T) {
+	renderMap := map[interface{}]interface{}{
+		"metric_path": "a.b.c",
+		"start":       int64(1000),
+		"step":        int64(10),
+		"values":      []interface{}{1.0, nil, 3.0},
+	}
+
+	span := opentracing.StartSpan("test")
+	defer span.Finish()
+
+	items := expandRenderMap(renderMap, span)
+	if len(items) != 2 {
+		t.Fatalf("expandRenderMap(...) returned %d items, want 2 (nil value skipped)", len(items))
+	}
+
+	want := []string{"a.b.c 1.000000 1000", "a.b.c 3.000000 1020"}
+	for i, item := range items {
+		if string(item.buf) != want[i] {
+			t.Errorf("items[%d].buf = %q, want %q", i, item.buf, want[i])
+		}
+		item.span.Finish()
+	}
+}
+
+func TestExpandRenderMapMissingFields(t *testing.T) {
+	cases := map[string]map[interface{}]interface{}{
+		"missing metric_path": {
+			"start": int64(1000), "step": int64(10), "values": []interface{}{1.0},
+		},
+		"missing values": {
+			"metric_path": "a.b.c", "start": int64(1000), "step": int64(10),
+		},
+		"missing start/step": {
+			"metric_path": "a.b.c", "values": []interface{}{1.0},
+		},
+	}
+
+	for name, renderMap := range cases {
+		t.Run(name, func(t *testing.T) {
+			span := opentracing.StartSpan("test")
+			defer span.Finish()
+
+			if items := expandRenderMap(renderMap, span); items != nil {
+				t.Errorf("expandRenderMap(%v) = %v, want nil", renderMap, items)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Package route defines the destinations a table.Table fans dispatched
+// metrics out to (carbon backends, Kafka topics, ...). This tree only
+// carries the interface and the span-recording helper concrete routes are
+// expected to use; the destinations themselves live elsewhere.
+package route
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// Route is a single destination a dispatched metric is sent to. ctx carries
+// the span for the item being sent (see table.Table.Dispatch), so Send can
+// record its own send-latency/failure span as a child of it.
+type Route interface {
+	Key() string
+	Send(ctx context.Context, buf []byte, val float64, ts uint32)
+}
+
+// TraceSend runs send, wrapping it in a "route.send" span that's a child of
+// whatever span ctx carries. It records how long send took and, if send
+// returns an error, tags the span as failed and logs the error - the same
+// bookkeeping every Route implementation would otherwise have to repeat.
+func TraceSend(ctx context.Context, key string, send func() error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "route.send")
+	span.SetTag("route", key)
+	defer span.Finish()
+
+	start := time.Now()
+	err := send()
+	span.SetTag("send.duration_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		span.SetTag("error", true)
+		span.LogFields(otlog.String("event", "error"), otlog.String("message", err.Error()))
+	}
+}
@@ -0,0 +1,28 @@
+// Package table holds the set of routes a validated metric is dispatched
+// to. The full table also owns matching rules, aggregators, and the admin
+// API; this tree only carries the Dispatch boundary the input packages call
+// into.
+package table
+
+import (
+	"context"
+
+	"github.com/graphite-ng/carbon-relay-ng/route"
+)
+
+// Table fans a dispatched metric out to every route matching it. Routing
+// rules aren't modeled here yet, so Dispatch sends to every route in Routes.
+type Table struct {
+	Routes []route.Route
+}
+
+// Dispatch sends a metric, already validated by the caller, to every route
+// in the table. ctx carries the span the calling input started for this
+// item (see input.expandPickleItem and input.Pickle.validateAndDispatch) so
+// each route.Send can record its own send-latency/failure span as a child of
+// it. Dispatch does not finish that span; the caller does.
+func (t *Table) Dispatch(ctx context.Context, buf []byte, val float64, ts uint32) {
+	for _, r := range t.Routes {
+		r.Send(ctx, buf, val, ts)
+	}
+}
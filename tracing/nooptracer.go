@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// nooptracer is installed as the global tracer when tracing is disabled in
+// config, so that Pickle.Handle and friends can start spans unconditionally
+// without an extra "is tracing enabled" branch at every call site. Builds
+// without a configured collector still compile and run against this tracer.
+type nooptracer struct{}
+
+func (nooptracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	return noopSpan{}
+}
+
+func (nooptracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	return nil
+}
+
+func (nooptracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	return noopSpanContext{}, opentracing.ErrSpanContextNotFound
+}
+
+type noopSpanContext struct{}
+
+func (noopSpanContext) ForeachBaggageItem(handler func(k, v string) bool) {}
+
+type noopSpan struct{}
+
+func (noopSpan) Finish()                                                {}
+func (noopSpan) FinishWithOptions(opts opentracing.FinishOptions)       {}
+func (noopSpan) Context() opentracing.SpanContext                       { return noopSpanContext{} }
+func (noopSpan) SetOperationName(operationName string) opentracing.Span { return noopSpan{} }
+func (noopSpan) SetTag(key string, value interface{}) opentracing.Span  { return noopSpan{} }
+func (noopSpan) LogFields(fields ...log.Field)                          {}
+func (noopSpan) LogKV(alternatingKeyValues ...interface{})              {}
+func (noopSpan) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	return noopSpan{}
+}
+func (noopSpan) BaggageItem(restrictedKey string) string               { return "" }
+func (noopSpan) Tracer() opentracing.Tracer                            { return nooptracer{} }
+func (noopSpan) LogEvent(event string)                                 {}
+func (noopSpan) LogEventWithPayload(event string, payload interface{}) {}
+func (noopSpan) Log(data opentracing.LogData)                          {}
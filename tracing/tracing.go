@@ -0,0 +1,95 @@
+// Package tracing initializes a global OpenTracing tracer for carbon-relay-ng,
+// so that inputs and routes can record spans describing where metrics spend
+// their time as they flow through the relay.
+package tracing
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/opentracing/opentracing-go"
+	zipkin "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	zipkingo "github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// Config is the [tracing] block in the relay's config file.
+type Config struct {
+	Enabled     bool
+	Collector   string // "zipkin" or "jaeger"
+	Endpoint    string
+	ServiceName string
+	SamplerRate float64
+}
+
+// Init sets the global OpenTracing tracer according to cfg. When cfg.Enabled
+// is false, the nooptracer is installed so callers can unconditionally start
+// spans without checking whether tracing is on. The returned io.Closer must
+// be closed on shutdown to flush any buffered spans.
+func Init(cfg Config) (io.Closer, error) {
+	if !cfg.Enabled {
+		opentracing.SetGlobalTracer(&nooptracer{})
+		return nopCloser{}, nil
+	}
+
+	switch cfg.Collector {
+	case "zipkin":
+		return initZipkin(cfg)
+	case "jaeger":
+		return initJaeger(cfg)
+	default:
+		return nil, fmt.Errorf("tracing.go: unrecognized collector type %q", cfg.Collector)
+	}
+}
+
+func initZipkin(cfg Config) (io.Closer, error) {
+	reporter := zipkinhttp.NewReporter(cfg.Endpoint)
+
+	endpoint, err := zipkingo.NewEndpoint(cfg.ServiceName, "")
+	if err != nil {
+		reporter.Close()
+		return nil, fmt.Errorf("tracing.go: couldn't create zipkin endpoint: %s", err)
+	}
+
+	sampler, err := zipkingo.NewBoundarySampler(cfg.SamplerRate, 0)
+	if err != nil {
+		reporter.Close()
+		return nil, fmt.Errorf("tracing.go: couldn't create zipkin sampler: %s", err)
+	}
+
+	nativeTracer, err := zipkingo.NewTracer(reporter, zipkingo.WithLocalEndpoint(endpoint), zipkingo.WithSampler(sampler))
+	if err != nil {
+		reporter.Close()
+		return nil, fmt.Errorf("tracing.go: couldn't create zipkin tracer: %s", err)
+	}
+
+	opentracing.SetGlobalTracer(zipkin.Wrap(nativeTracer))
+	return reporter, nil
+}
+
+func initJaeger(cfg Config) (io.Closer, error) {
+	jcfg := jaegercfg.Configuration{
+		ServiceName: cfg.ServiceName,
+		Sampler: &jaegercfg.SamplerConfig{
+			Type:  jaeger.SamplerTypeProbabilistic,
+			Param: cfg.SamplerRate,
+		},
+		Reporter: &jaegercfg.ReporterConfig{
+			LocalAgentHostPort: cfg.Endpoint,
+		},
+	}
+
+	tracer, closer, err := jcfg.NewTracer()
+	if err != nil {
+		return nil, fmt.Errorf("tracing.go: couldn't create jaeger tracer: %s", err)
+	}
+
+	opentracing.SetGlobalTracer(tracer)
+	return closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }